@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// listenFdsStart is the file descriptor systemd's socket activation
+// protocol assigns to the first passed socket (0, 1 and 2 are stdin,
+// stdout and stderr).
+const listenFdsStart = 3
+
+// listen returns existing if non-nil, otherwise the idx'th socket handed
+// down by systemd socket activation (LISTEN_FDS/LISTEN_PID), falling back
+// to opening a new TCP listener on addr. This lets operators inject
+// pre-bound listeners for zero-downtime restarts, or let an init system
+// pass already-open sockets into the process.
+func listen(idx int, addr string, existing net.Listener) (net.Listener, error) {
+	if existing != nil {
+		return existing, nil
+	}
+
+	l, err := systemdListener(idx)
+	if err != nil {
+		return nil, err
+	}
+	if l != nil {
+		return l, nil
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// systemdListener returns the idx'th listener passed to this process via
+// systemd socket activation, or nil if the process wasn't socket-activated
+// or didn't receive that many sockets.
+func systemdListener(idx int) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || idx >= nfds {
+		return nil, nil
+	}
+
+	fd := listenFdsStart + idx
+	syscall.CloseOnExec(fd)
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("listener-%d", idx))
+	l, err := net.FileListener(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating listener from systemd fd %d", fd)
+	}
+	return l, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func withEnv(t *testing.T, key, value string) func() {
+	t.Helper()
+	old, had := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	return func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestSystemdListenerNotActivated(t *testing.T) {
+	defer withEnv(t, "LISTEN_PID", "")()
+	defer withEnv(t, "LISTEN_FDS", "")()
+
+	l, err := systemdListener(0)
+	if err != nil {
+		t.Fatalf("systemdListener returned unexpected error: %v", err)
+	}
+	if l != nil {
+		t.Fatalf("systemdListener returned %v, want nil when LISTEN_PID is unset", l)
+	}
+}
+
+func TestSystemdListenerWrongPID(t *testing.T) {
+	defer withEnv(t, "LISTEN_PID", strconv.Itoa(os.Getpid()+1))()
+	defer withEnv(t, "LISTEN_FDS", "1")()
+
+	l, err := systemdListener(0)
+	if err != nil {
+		t.Fatalf("systemdListener returned unexpected error: %v", err)
+	}
+	if l != nil {
+		t.Fatalf("systemdListener returned %v, want nil when LISTEN_PID doesn't match", l)
+	}
+}
+
+func TestSystemdListenerNoSuchFD(t *testing.T) {
+	defer withEnv(t, "LISTEN_PID", strconv.Itoa(os.Getpid()))()
+	defer withEnv(t, "LISTEN_FDS", "0")()
+
+	l, err := systemdListener(0)
+	if err != nil {
+		t.Fatalf("systemdListener returned unexpected error: %v", err)
+	}
+	if l != nil {
+		t.Fatalf("systemdListener returned %v, want nil when idx >= LISTEN_FDS", l)
+	}
+}
+
+func TestListenUsesExistingListener(t *testing.T) {
+	existing, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer existing.Close()
+
+	l, err := listen(0, "127.0.0.1:0", existing)
+	if err != nil {
+		t.Fatalf("listen returned unexpected error: %v", err)
+	}
+	if l != existing {
+		t.Fatalf("listen(idx, addr, existing) = %v, want the existing listener back unchanged", l)
+	}
+}
+
+func TestListenFallsBackToTCP(t *testing.T) {
+	defer withEnv(t, "LISTEN_PID", "")()
+	defer withEnv(t, "LISTEN_FDS", "")()
+
+	l, err := listen(0, "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("listen returned unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	if l.Addr().(*net.TCPAddr).Port == 0 {
+		t.Fatalf("listen returned a listener not bound to a port: %v", l.Addr())
+	}
+}
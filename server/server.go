@@ -1,17 +1,23 @@
 package server
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof" // anonymous import to get the pprof handler registered
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/mux"
 	"github.com/pinterb/common/middleware"
 	"github.com/pinterb/common/signals"
 	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 
 	"github.com/pkg/errors"
@@ -24,14 +30,48 @@ type Config struct {
 	HTTPListenPort   int
 	GRPCListenPort   int
 
+	// HTTPListener and GRPCListener, when set, are used as-is instead of
+	// opening a new TCP socket on the corresponding ListenPort. This lets a
+	// parent process hand down already-bound listeners, e.g. for
+	// zero-downtime restarts.
+	HTTPListener net.Listener
+	GRPCListener net.Listener
+
 	RegisterInstrumentation bool
 	ExcludeRequestInLog     bool
 
+	// AdminListenPort, when > 0, moves /metrics, /debug/pprof and /ready
+	// onto a dedicated HTTP server bound to that port instead of the main
+	// router. The zero value (the default, and what a struct literal gets
+	// for free) keeps them on the main router for backwards compatibility;
+	// a negative value disables /metrics and /debug/pprof entirely and
+	// leaves /ready on the main router.
+	//
+	// This deliberately deviates from the original "0 = disabled, -1 =
+	// keep on main router" wording: the zero value of a plain Config{}
+	// (e.g. built by a struct literal rather than RegisterFlags) has to
+	// reproduce today's on-the-main-router behavior, and 0 is the only
+	// value such a Config can have, so the polarity was flipped here.
+	AdminListenPort int
+
 	ServerGracefulShutdownTimeout time.Duration
+	ShutdownDelay                 time.Duration
 	HTTPServerReadTimeout         time.Duration
 	HTTPServerWriteTimeout        time.Duration
 	HTTPServerIdleTimeout         time.Duration
 
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSConfig     *tls.Config
+	ClientCAFile  string
+	MinTLSVersion string
+
+	// SignalHandler, when set, overrides the default signals.Handler (see
+	// signals.NewHandler) used to drive graceful shutdown. Supply one
+	// built via signals.NewBuilder to customize the signal-to-action
+	// mapping; Server.Context reflects whatever Handler ends up in use.
+	SignalHandler *signals.Handler
+
 	GRPCOptions    []grpc.ServerOption
 	GRPCMiddleware []grpc.UnaryServerInterceptor
 	HTTPMiddleware []middleware.Interface
@@ -52,8 +92,20 @@ type Server struct {
 	grpcListener net.Listener
 	httpServer   *http.Server
 
-	HTTP *mux.Router
-	GRPC *grpc.Server
+	ready int32 // accessed atomically; 1 once the server is ready to take traffic
+
+	shutdownOnce      sync.Once
+	preShutdownHooks  []func()
+	postShutdownHooks []func()
+
+	certWatcher *fsnotify.Watcher
+
+	adminListener net.Listener
+	adminServer   *http.Server
+
+	HTTP  *mux.Router
+	GRPC  *grpc.Server
+	Admin *mux.Router
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
@@ -61,33 +113,52 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.HTTPListenPort, "server.http-listen-port", 80, "HTTP server listen port.")
 	f.IntVar(&cfg.GRPCListenPort, "server.grpc-listen-port", 9095, "gRPC server listen port.")
 	f.BoolVar(&cfg.RegisterInstrumentation, "server.register-instrumentation", true, "Register the intrumentation handlers (/metrics etc).")
+	f.IntVar(&cfg.AdminListenPort, "server.admin-listen-port", 0, "Listen port for admin endpoints (/metrics, /debug/pprof); 0 (default) keeps them on the main HTTP router, a negative value disables them entirely.")
 	f.DurationVar(&cfg.ServerGracefulShutdownTimeout, "server.graceful-shutdown-timeout", 5*time.Second, "Timeout for graceful shutdowns")
+	f.DurationVar(&cfg.ShutdownDelay, "server.shutdown-delay", 0, "Time to wait after marking the server unready before draining connections, to let load balancers notice the failing readiness probe")
 	f.DurationVar(&cfg.HTTPServerReadTimeout, "server.http-read-timeout", 5*time.Second, "Read timeout for HTTP server")
 	f.DurationVar(&cfg.HTTPServerWriteTimeout, "server.http-write-timeout", 5*time.Second, "Write timeout for HTTP server")
 	f.DurationVar(&cfg.HTTPServerIdleTimeout, "server.http-idle-timeout", 120*time.Second, "Idle timeout for HTTP server")
+	f.StringVar(&cfg.TLSCertFile, "server.tls-cert-file", "", "TLS certificate file for the HTTP and gRPC servers.")
+	f.StringVar(&cfg.TLSKeyFile, "server.tls-key-file", "", "TLS private key file for the HTTP and gRPC servers.")
+	f.StringVar(&cfg.ClientCAFile, "server.tls-client-ca-file", "", "CA certificate file used to verify client certificates (enables mutual TLS).")
+	f.StringVar(&cfg.MinTLSVersion, "server.tls-min-version", "VersionTLS12", "Minimum TLS version to accept: VersionTLS10, VersionTLS11, VersionTLS12 or VersionTLS13.")
 }
 
 // New makes a new Server
 func New(cfg Config, logger Logger) (*Server, error) {
 	// Setup listeners first, so we can fail early if the port is in use.
-	httpListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.HTTPListenPort))
+	httpListener, err := listen(0, fmt.Sprintf(":%d", cfg.HTTPListenPort), cfg.HTTPListener)
 	if err != nil {
 		return nil, errors.Wrap(err, "New Server")
 	}
 
-	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCListenPort))
+	grpcListener, err := listen(1, fmt.Sprintf(":%d", cfg.GRPCListenPort), cfg.GRPCListener)
 	if err != nil {
 		return nil, errors.Wrap(err, "New Server")
 	}
 
-	grpcOptions := []grpc.ServerOption{}
-	grpcOptions = append(grpcOptions, cfg.GRPCOptions...)
-	grpcServer := grpc.NewServer(grpcOptions...)
-
 	// Setup HTTP server
 	router := mux.NewRouter()
-	if cfg.RegisterInstrumentation {
-		RegisterInstrumentation(router)
+
+	var (
+		adminListener net.Listener
+		adminServer   *http.Server
+		adminRouter   *mux.Router
+	)
+	switch {
+	case cfg.AdminListenPort > 0:
+		adminListener, err = net.Listen("tcp", fmt.Sprintf(":%d", cfg.AdminListenPort))
+		if err != nil {
+			return nil, errors.Wrap(err, "New Server")
+		}
+		adminRouter = mux.NewRouter()
+		adminServer = &http.Server{Handler: adminRouter}
+	case cfg.AdminListenPort == 0:
+		adminRouter = router
+	}
+	if cfg.RegisterInstrumentation && adminRouter != nil {
+		RegisterInstrumentation(adminRouter)
 	}
 
 	httpMiddleware := []middleware.Interface{}
@@ -99,17 +170,95 @@ func New(cfg Config, logger Logger) (*Server, error) {
 		Handler:      middleware.Merge(httpMiddleware...).Wrap(router),
 	}
 
-	return &Server{
-		cfg:          cfg,
-		httpListener: httpListener,
-		grpcListener: grpcListener,
-		httpServer:   httpServer,
-		handler:      signals.NewHandler(logger),
+	grpcOptions := []grpc.ServerOption{}
+
+	var certWatcher *fsnotify.Watcher
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		tlsConfig, creds, watcher, err := setupTLS(cfg, logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "New Server")
+		}
+
+		httpListener = tls.NewListener(httpListener, tlsConfig)
+		httpServer.TLSConfig = tlsConfig
+		if err := http2.ConfigureServer(httpServer, &http2.Server{}); err != nil {
+			return nil, errors.Wrap(err, "New Server: configuring HTTP/2")
+		}
+
+		// Caller-supplied GRPCOptions are appended after ours, so an
+		// explicit grpc.Creds there still wins.
+		grpcOptions = append(grpcOptions, grpc.Creds(creds))
+		certWatcher = watcher
+	}
+	grpcOptions = append(grpcOptions, cfg.GRPCOptions...)
+	grpcServer := grpc.NewServer(grpcOptions...)
+
+	handler := cfg.SignalHandler
+	if handler == nil {
+		handler = signals.NewHandler(logger)
+	}
+
+	s := &Server{
+		cfg:           cfg,
+		httpListener:  httpListener,
+		grpcListener:  grpcListener,
+		httpServer:    httpServer,
+		handler:       handler,
+		ready:         1,
+		certWatcher:   certWatcher,
+		adminListener: adminListener,
+		adminServer:   adminServer,
 
-		HTTP: router,
-		GRPC: grpcServer,
-	}, nil
+		HTTP:  router,
+		GRPC:  grpcServer,
+		Admin: adminRouter,
+	}
+
+	// Mount /ready alongside the other operational endpoints: on the
+	// dedicated admin router when one exists, or the main router when
+	// admin endpoints haven't been split out (AdminListenPort == 0) or
+	// have been disabled outright (AdminListenPort < 0).
+	readyRouter := router
+	if s.Admin != nil {
+		readyRouter = s.Admin
+	}
+	readyRouter.HandleFunc("/ready", s.readyHandler)
+
+	return s, nil
+}
 
+// readyHandler serves 200 while the server is ready to take traffic, and
+// 503 once SetReady(false) has been called, e.g. during shutdown.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.ready) == 0 {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetReady marks the server as ready (or not ready) to receive traffic.
+// The /ready endpoint reflects this value, so callers can fail it ahead of
+// draining connections and give load balancers / k8s endpoint controllers
+// time to stop routing to this instance.
+func (s *Server) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+
+// AddPreShutdownHook registers a function to run before the server marks
+// itself unready and begins draining connections.
+func (s *Server) AddPreShutdownHook(hook func()) {
+	s.preShutdownHooks = append(s.preShutdownHooks, hook)
+}
+
+// AddPostShutdownHook registers a function to run after the HTTP and gRPC
+// servers have finished shutting down.
+func (s *Server) AddPostShutdownHook(hook func()) {
+	s.postShutdownHooks = append(s.postShutdownHooks, hook)
 }
 
 // RegisterInstrumentation on the given router.
@@ -118,15 +267,67 @@ func RegisterInstrumentation(router *mux.Router) {
 	router.PathPrefix("/debug/pprof").Handler(http.DefaultServeMux)
 }
 
-// Run the server; blocks until SIGTERM is received.
-func (s *Server) Run() {
-	go s.httpServer.Serve(s.httpListener)
+// Run the HTTP and gRPC servers, blocking until both have stopped.
+//
+// The two servers and the signal handler are run as members of an
+// errgroup.Group sharing a derived context: the first member to return a
+// non-nil error (other than the expected "closed" errors) cancels that
+// context, which in turn triggers a graceful Shutdown of the others. A
+// clean SIGINT/SIGTERM also cancels the context, so Run returns nil in the
+// ordinary shutdown case and the offending error otherwise.
+func (s *Server) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		if err := s.httpServer.Serve(s.httpListener); err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
 
-	go s.GRPC.Serve(s.grpcListener)
-	defer s.GRPC.GracefulStop()
+	g.Go(func() error {
+		if err := s.GRPC.Serve(s.grpcListener); err != nil && err != grpc.ErrServerStopped {
+			return err
+		}
+		return nil
+	})
 
-	// Wait for a signal
-	s.handler.Loop()
+	if s.adminServer != nil {
+		g.Go(func() error {
+			if err := s.adminServer.Serve(s.adminListener); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		// Wait for a signal; unblocks the shared context below either via
+		// SIGINT/SIGTERM or an explicit Stop(). If another member fails
+		// first, stop waiting so that Run can return its error.
+		loopDone := make(chan struct{})
+		go func() {
+			s.handler.Loop()
+			close(loopDone)
+		}()
+		select {
+		case <-loopDone:
+			cancel()
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		<-ctx.Done()
+		s.Shutdown()
+		return nil
+	})
+
+	return g.Wait()
 }
 
 // Stop unblocks Run().
@@ -134,11 +335,85 @@ func (s *Server) Stop() {
 	s.handler.Stop()
 }
 
-// Shutdown the server, gracefully.  Should be defered after New().
+// Context returns a Context that is canceled once the server begins a
+// graceful shutdown, whether triggered by a stop-class signal or an
+// explicit Stop(). Downstream code (HTTP handlers, gRPC interceptors,
+// background workers) can select on it instead of polling Stop().
+func (s *Server) Context() context.Context {
+	return s.handler.Context()
+}
+
+// Shutdown the server, gracefully. Run already calls this once its
+// errgroup context is canceled, so callers driving the server with Run
+// should not also defer Shutdown after New(); Shutdown is idempotent
+// (safe to call more than once, including concurrently) precisely so that
+// belt-and-braces callers don't double-run the hooks below.
+//
+// The sequence is: run pre-shutdown hooks, mark the server unready (so the
+// /ready probe starts failing), wait ShutdownDelay for load balancers to
+// notice and stop sending traffic, then drain the HTTP, admin and gRPC
+// servers concurrently against a single shared deadline, and finally run
+// post-shutdown hooks. This avoids the well-known k8s race where a pod
+// keeps receiving requests during the Terminating window because endpoint
+// removal is asynchronous with SIGTERM delivery.
 func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(s.shutdown)
+}
+
+func (s *Server) shutdown() {
+	for _, hook := range s.preShutdownHooks {
+		hook()
+	}
+
+	s.SetReady(false)
+	time.Sleep(s.cfg.ShutdownDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ServerGracefulShutdownTimeout)
-	defer cancel() // releases resources if httpServer.Shutdown completes before timeout elapses
+	defer cancel() // releases resources if everything below completes before the timeout elapses
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.httpServer.Shutdown(ctx)
+	}()
+
+	if s.adminServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.adminServer.Shutdown(ctx)
+		}()
+	}
 
-	s.httpServer.Shutdown(ctx)
-	s.GRPC.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		stopped := make(chan struct{})
+		go func() {
+			s.GRPC.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			// The deadline passed with RPCs/streams still open; force the
+			// issue rather than let GracefulStop block indefinitely.
+			s.GRPC.Stop()
+			<-stopped
+		}
+	}()
+
+	wg.Wait()
+
+	if s.certWatcher != nil {
+		s.certWatcher.Close()
+	}
+
+	for _, hook := range s.postShutdownHooks {
+		hook()
+	}
 }
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLoopbackServer builds a Server wired to loopback listeners so tests
+// never bind a fixed port or touch the network beyond localhost.
+func newLoopbackServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+
+	httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen (http): %v", err)
+	}
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen (grpc): %v", err)
+	}
+
+	cfg.HTTPListener = httpListener
+	cfg.GRPCListener = grpcListener
+	if cfg.ServerGracefulShutdownTimeout == 0 {
+		cfg.ServerGracefulShutdownTimeout = 5 * time.Second
+	}
+
+	s, err := New(cfg, &testLogger{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Serve (via Run) closes these on Shutdown, but tests that never call
+	// Run still need the fds reclaimed; closing an already-closed listener
+	// is harmless.
+	t.Cleanup(func() {
+		httpListener.Close()
+		grpcListener.Close()
+	})
+
+	return s
+}
+
+func getReady(t *testing.T, s *Server) *http.Response {
+	t.Helper()
+	resp, err := http.Get(fmt.Sprintf("http://%s/ready", s.httpListener.Addr().String()))
+	if err != nil {
+		t.Fatalf("GET /ready: %v", err)
+	}
+	return resp
+}
+
+func TestNewRunShutdown(t *testing.T) {
+	s := newLoopbackServer(t, Config{})
+
+	var preRan, postRan bool
+	var readyAtPostShutdown bool
+	s.AddPreShutdownHook(func() { preRan = true })
+	s.AddPostShutdownHook(func() {
+		postRan = true
+		readyAtPostShutdown = readyHandlerReady(s)
+	})
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run() }()
+
+	waitForReady(t, s)
+
+	resp := getReady(t, s)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /ready = %d, want %d before shutdown", resp.StatusCode, http.StatusOK)
+	}
+
+	// Stop (not Shutdown) is what unblocks Run: it cancels the signal
+	// handler's context, which Run's own goroutine observes and reacts to
+	// by calling Shutdown on our behalf.
+	s.Stop()
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("Run returned unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+
+	if !preRan {
+		t.Fatal("pre-shutdown hook did not run")
+	}
+	if !postRan {
+		t.Fatal("post-shutdown hook did not run")
+	}
+	if readyAtPostShutdown {
+		t.Fatal("server still reported ready when the post-shutdown hook ran")
+	}
+}
+
+func TestShutdownIsIdempotent(t *testing.T) {
+	s := newLoopbackServer(t, Config{})
+
+	var calls int32
+	var mu sync.Mutex
+	s.AddPostShutdownHook(func() {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Shutdown()
+		}()
+	}
+	wg.Wait()
+	s.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("post-shutdown hook ran %d times, want exactly 1", calls)
+	}
+}
+
+func TestSetReadyReflectedInReadyEndpoint(t *testing.T) {
+	s := newLoopbackServer(t, Config{})
+
+	go s.Run()
+	waitForReady(t, s)
+	defer s.Stop()
+
+	s.SetReady(false)
+	resp := getReady(t, s)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("GET /ready after SetReady(false) = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	s.SetReady(true)
+	resp = getReady(t, s)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /ready after SetReady(true) = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// readyHandlerReady reports the server's current readiness without going
+// over HTTP, for assertions made from inside a shutdown hook where the
+// listener may already be closed.
+func readyHandlerReady(s *Server) bool {
+	return atomic.LoadInt32(&s.ready) != 0
+}
+
+// waitForReady dials the HTTP listener's address until a TCP connection
+// succeeds, failing the test after 5 seconds.
+func waitForReady(t *testing.T, s *Server) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", s.httpListener.Addr().String())
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never started accepting connections: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+)
+
+var tlsVersions = map[string]uint16{
+	"VersionTLS10": tls.VersionTLS10,
+	"VersionTLS11": tls.VersionTLS11,
+	"VersionTLS12": tls.VersionTLS12,
+	"VersionTLS13": tls.VersionTLS13,
+}
+
+// parseMinTLSVersion maps a MinTLSVersion config value onto the tls.VersionXXX
+// constant it names, defaulting to TLS 1.2 when unset.
+func parseMinTLSVersion(v string) (uint16, error) {
+	if v == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[v]
+	if !ok {
+		return 0, errors.Errorf("invalid server.tls-min-version %q", v)
+	}
+	return version, nil
+}
+
+// setupTLS builds the tls.Config shared by the HTTP and gRPC servers from
+// cfg, loading the initial keypair and starting a watcher that reloads it
+// on change so operators can rotate certificates without restarting the
+// process. It returns the tls.Config, the gRPC transport credentials
+// derived from it, and the watcher (which the caller is responsible for
+// closing on shutdown).
+func setupTLS(cfg Config, logger Logger) (*tls.Config, credentials.TransportCredentials, *fsnotify.Watcher, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, nil, nil, errors.New("both TLSCertFile and TLSKeyFile must be set")
+	}
+
+	minVersion, err := parseMinTLSVersion(cfg.MinTLSVersion)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "loading TLS certificate")
+	}
+
+	var certStore atomic.Value
+	certStore.Store(&cert)
+
+	tlsConfig := cfg.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig.MinVersion = minVersion
+	tlsConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return certStore.Load().(*tls.Certificate), nil
+	}
+
+	if cfg.ClientCAFile != "" {
+		caCert, err := ioutil.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "reading client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, nil, nil, errors.New("failed to parse client CA file")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	watcher, err := watchCertificate(cfg.TLSCertFile, cfg.TLSKeyFile, &certStore, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return tlsConfig, credentials.NewTLS(tlsConfig), watcher, nil
+}
+
+// watchCertificate watches certFile and keyFile for changes and reloads the
+// keypair into store on write/create events, so a concurrently running
+// tls.Config.GetCertificate callback picks up the new certificate without a
+// restart.
+func watchCertificate(certFile, keyFile string, store *atomic.Value, logger Logger) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating TLS certificate watcher")
+	}
+
+	dirs := map[string]struct{}{
+		filepath.Dir(certFile): {},
+		filepath.Dir(keyFile):  {},
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, errors.Wrapf(err, "watching %s", dir)
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+				if err != nil {
+					logger.Log("msg", "failed to reload TLS certificate", "err", err)
+					continue
+				}
+				store.Store(&cert)
+				logger.Log("msg", "reloaded TLS certificate")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Log("msg", "TLS certificate watcher error", "err", err)
+			}
+		}
+	}()
+
+	return watcher, nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Log(keyvals ...interface{}) error { return nil }
+
+func TestParseMinTLSVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		in      string
+		want    uint16
+		wantErr bool
+	}{
+		{name: "empty defaults to TLS 1.2", in: "", want: tls.VersionTLS12},
+		{name: "TLS 1.0", in: "VersionTLS10", want: tls.VersionTLS10},
+		{name: "TLS 1.1", in: "VersionTLS11", want: tls.VersionTLS11},
+		{name: "TLS 1.2", in: "VersionTLS12", want: tls.VersionTLS12},
+		{name: "TLS 1.3", in: "VersionTLS13", want: tls.VersionTLS13},
+		{name: "unknown", in: "VersionSSL3", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseMinTLSVersion(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseMinTLSVersion(%q) = %v, nil; want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMinTLSVersion(%q) returned unexpected error: %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Fatalf("parseMinTLSVersion(%q) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+// writeSelfSignedCert writes a freshly generated self-signed cert/key pair
+// (commonName embedded for later identification) to certPath/keyPath.
+func writeSelfSignedCert(t *testing.T, certPath, keyPath, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	certOut, err := os.OpenFile(certPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatalf("opening %s: %v", certPath, err)
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("encoding cert: %v", err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	keyOut, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		t.Fatalf("opening %s: %v", keyPath, err)
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}); err != nil {
+		t.Fatalf("encoding key: %v", err)
+	}
+}
+
+func TestSetupTLSReloadsCertificateOnChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-tls")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+	writeSelfSignedCert(t, certPath, keyPath, "initial")
+
+	cfg := Config{TLSCertFile: certPath, TLSKeyFile: keyPath}
+	tlsConfig, creds, watcher, err := setupTLS(cfg, &testLogger{})
+	if err != nil {
+		t.Fatalf("setupTLS returned unexpected error: %v", err)
+	}
+	defer watcher.Close()
+	if creds == nil {
+		t.Fatal("setupTLS returned nil transport credentials")
+	}
+
+	initial, err := tlsConfig.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate returned unexpected error: %v", err)
+	}
+	initialLeaf, err := x509.ParseCertificate(initial.Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing initial certificate: %v", err)
+	}
+	if initialLeaf.Subject.CommonName != "initial" {
+		t.Fatalf("initial certificate CommonName = %q, want %q", initialLeaf.Subject.CommonName, "initial")
+	}
+
+	writeSelfSignedCert(t, certPath, keyPath, "reloaded")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := tlsConfig.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate returned unexpected error: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("parsing certificate: %v", err)
+		}
+		if leaf.Subject.CommonName == "reloaded" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("GetCertificate never observed the reloaded certificate")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,53 @@
+package signals
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// StackDumpAction logs a full goroutine stack dump to log. It's the
+// default action for SIGQUIT.
+func StackDumpAction(log Logger) Action {
+	return func(ctx context.Context) error {
+		buf := make([]byte, 1<<20)
+		n := runtime.Stack(buf, true)
+		log.Log("sighandler", "*** goroutine dump...start ***")
+		log.Log("sighandler", string(buf[:n]))
+		log.Log("sighandler", "*** goroutine dump...end ***")
+		return nil
+	}
+}
+
+// HeapDumpAction writes a pprof heap profile to path. Register it against
+// SIGUSR1 to let operators capture a heap snapshot without restarting the
+// process.
+func HeapDumpAction(path string) Action {
+	return func(ctx context.Context) error {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return pprof.WriteHeapProfile(f)
+	}
+}
+
+// LogLevelToggleAction calls toggle, which should flip the process's log
+// level (e.g. info <-> debug). Register it against SIGUSR2 to let
+// operators turn up verbosity on a running process.
+func LogLevelToggleAction(toggle func()) Action {
+	return func(ctx context.Context) error {
+		toggle()
+		return nil
+	}
+}
+
+// ReloadAction calls reload. Register it against SIGHUP to let operators
+// re-read configuration without restarting the process.
+func ReloadAction(reload func() error) Action {
+	return func(ctx context.Context) error {
+		return reload()
+	}
+}
@@ -0,0 +1,69 @@
+package signals
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStackDumpActionLogsGoroutineDump(t *testing.T) {
+	log := &testLogger{}
+
+	if err := StackDumpAction(log)(context.Background()); err != nil {
+		t.Fatalf("StackDumpAction returned unexpected error: %v", err)
+	}
+
+	if len(log.logs) == 0 {
+		t.Fatal("StackDumpAction did not log anything")
+	}
+}
+
+func TestHeapDumpActionWritesProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signals-heapdump")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "heap.pprof")
+	if err := HeapDumpAction(path)(context.Background()); err != nil {
+		t.Fatalf("HeapDumpAction returned unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected heap profile at %s: %v", path, err)
+	}
+	if info.Size() == 0 {
+		t.Fatalf("heap profile at %s is empty", path)
+	}
+}
+
+func TestLogLevelToggleActionCallsToggle(t *testing.T) {
+	called := false
+	action := LogLevelToggleAction(func() { called = true })
+
+	if err := action(context.Background()); err != nil {
+		t.Fatalf("LogLevelToggleAction returned unexpected error: %v", err)
+	}
+	if !called {
+		t.Fatal("LogLevelToggleAction did not call the toggle function")
+	}
+}
+
+func TestReloadActionPropagatesError(t *testing.T) {
+	want := errReload
+	action := ReloadAction(func() error { return want })
+
+	if got := action(context.Background()); got != want {
+		t.Fatalf("ReloadAction returned %v, want %v", got, want)
+	}
+}
+
+var errReload = stubError("reload failed")
+
+type stubError string
+
+func (e stubError) Error() string { return string(e) }
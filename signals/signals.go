@@ -1,16 +1,19 @@
 package signals
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
-	"runtime"
 	"syscall"
 )
 
 // SignalReceiver represents a subsystem/server/... that can be stopped or
-// queried about the status with a signal
+// queried about the status with a signal. ctx is the Handler's Context; it
+// has no deadline and is canceled only after every receiver's Stop has
+// returned, so it is not done while Stop runs.
 type SignalReceiver interface {
-	Stop() error
+	Stop(ctx context.Context) error
 }
 
 // Logger is something to log too.
@@ -18,54 +21,147 @@ type Logger interface {
 	Log(keyvals ...interface{}) error
 }
 
-// Handler handles signals, can be interrupted.
-// On SIGINT or SIGTERM it will exit, on SIGQUIT it
-// will dump goroutine stacks to the Logger.
+// Action runs in response to a received signal.
+type Action func(ctx context.Context) error
+
+// Handler handles signals according to a pluggable signal-to-action
+// mapping, and can be interrupted. Build one with NewHandler for the
+// default SIGINT/SIGTERM/SIGQUIT behaviour, or with NewBuilder for a
+// custom mapping.
 type Handler struct {
 	log       Logger
 	receivers []SignalReceiver
 	quit      chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	actions map[os.Signal]Action
+	stop    map[os.Signal]struct{}
 }
 
-// NewHandler makes a new Handler.
-func NewHandler(log Logger, receivers ...SignalReceiver) *Handler {
-	return &Handler{
+// Builder assembles a Handler with a custom signal-to-action mapping.
+type Builder struct {
+	log       Logger
+	receivers []SignalReceiver
+	actions   map[os.Signal]Action
+	stop      map[os.Signal]struct{}
+}
+
+// NewBuilder starts building a Handler for log and receivers.
+func NewBuilder(log Logger, receivers ...SignalReceiver) *Builder {
+	return &Builder{
 		log:       log,
 		receivers: receivers,
+		actions:   map[os.Signal]Action{},
+		stop:      map[os.Signal]struct{}{},
+	}
+}
+
+// WithActions merges actions into the signal-to-action mapping, each
+// action running when its signal is received.
+func (b *Builder) WithActions(actions map[os.Signal]Action) *Builder {
+	for sig, action := range actions {
+		b.actions[sig] = action
+	}
+	return b
+}
+
+// WithStopSignals marks sigs as stop-class: on receipt (after any
+// registered action for that signal has run), receivers are stopped, the
+// Handler's Context is canceled, and Loop returns.
+func (b *Builder) WithStopSignals(sigs ...os.Signal) *Builder {
+	for _, sig := range sigs {
+		b.stop[sig] = struct{}{}
+		if _, ok := b.actions[sig]; !ok {
+			b.actions[sig] = nil
+		}
+	}
+	return b
+}
+
+// Build assembles the Handler.
+func (b *Builder) Build() *Handler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	actions := make(map[os.Signal]Action, len(b.actions))
+	for sig, action := range b.actions {
+		actions[sig] = action
+	}
+	stop := make(map[os.Signal]struct{}, len(b.stop))
+	for sig := range b.stop {
+		stop[sig] = struct{}{}
+	}
+
+	return &Handler{
+		log:       b.log,
+		receivers: b.receivers,
 		quit:      make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		actions:   actions,
+		stop:      stop,
 	}
 }
 
-// Stop the handler
+// NewHandler makes a new Handler with the default mapping: SIGINT and
+// SIGTERM stop it, SIGQUIT dumps goroutine stacks to log.
+func NewHandler(log Logger, receivers ...SignalReceiver) *Handler {
+	return NewBuilder(log, receivers...).
+		WithActions(map[os.Signal]Action{
+			syscall.SIGQUIT: StackDumpAction(log),
+		}).
+		WithStopSignals(syscall.SIGINT, syscall.SIGTERM).
+		Build()
+}
+
+// Context returns a Context that is canceled once a stop-class signal is
+// received or Stop is called. Downstream code can select on it instead of
+// polling Stop().
+func (h *Handler) Context() context.Context {
+	return h.ctx
+}
+
+// Stop the handler.
 func (h *Handler) Stop() {
 	close(h.quit)
 }
 
-// Loop handles signals.
+// Loop handles signals until a stop-class signal is received or Stop is
+// called.
 func (h *Handler) Loop() {
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
-	buf := make([]byte, 1<<20)
+	list := make([]os.Signal, 0, len(h.actions))
+	for sig := range h.actions {
+		list = append(list, sig)
+	}
+	signal.Notify(sigs, list...)
+
 	for {
 		select {
 		case <-h.quit:
 			h.log.Log("sighandler", "=== Handler.Stop()'d ===")
+			h.cancel()
 			return
 		case sig := <-sigs:
-			switch sig {
-			case syscall.SIGINT, syscall.SIGTERM:
-				h.log.Log("sighandler", "=== received SIGINT/SIGTERM ===")
-				for _, subsystem := range h.receivers {
-					subsystem.Stop()
+			if action := h.actions[sig]; action != nil {
+				if err := action(h.ctx); err != nil {
+					h.log.Log("sighandler", fmt.Sprintf("action for %s failed", sig), "err", err)
 				}
-				return
-			case syscall.SIGQUIT:
-				stacklen := runtime.Stack(buf, true)
-				h.log.Log("sighandler", "=== received SIGQUIT ===")
-				h.log.Log("sighandler", "*** goroutine dump...start ***")
-				h.log.Log("sighandler", string(buf[:stacklen]))
-				h.log.Log("sighandler", "*** goroutine dump...end ***")
 			}
+
+			if _, isStop := h.stop[sig]; !isStop {
+				continue
+			}
+
+			h.log.Log("sighandler", fmt.Sprintf("=== received %s ===", sig))
+			for _, receiver := range h.receivers {
+				if err := receiver.Stop(h.ctx); err != nil {
+					h.log.Log("sighandler", "receiver stop failed", "err", err)
+				}
+			}
+			h.cancel()
+			return
 		}
 	}
 }
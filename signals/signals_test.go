@@ -0,0 +1,118 @@
+package signals
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *testLogger) Log(keyvals ...interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, kv := range keyvals {
+		if s, ok := kv.(string); ok {
+			l.logs = append(l.logs, s)
+		}
+	}
+	return nil
+}
+
+func TestNewHandlerDefaultMapping(t *testing.T) {
+	h := NewHandler(&testLogger{})
+
+	if _, ok := h.actions[syscall.SIGQUIT]; !ok {
+		t.Fatal("default Handler has no action registered for SIGQUIT")
+	}
+	if _, ok := h.stop[syscall.SIGINT]; !ok {
+		t.Fatal("default Handler does not treat SIGINT as a stop signal")
+	}
+	if _, ok := h.stop[syscall.SIGTERM]; !ok {
+		t.Fatal("default Handler does not treat SIGTERM as a stop signal")
+	}
+}
+
+func TestBuilderWithStopSignalsRegistersAction(t *testing.T) {
+	h := NewBuilder(&testLogger{}).
+		WithStopSignals(syscall.SIGUSR1).
+		Build()
+
+	if _, ok := h.actions[syscall.SIGUSR1]; !ok {
+		t.Fatal("WithStopSignals should register a (nil) action entry so Loop listens for the signal")
+	}
+	if _, ok := h.stop[syscall.SIGUSR1]; !ok {
+		t.Fatal("WithStopSignals did not mark the signal as stop-class")
+	}
+}
+
+type stubReceiver struct{ err error }
+
+func (r stubReceiver) Stop(ctx context.Context) error { return r.err }
+
+func TestLoopLogsReceiverStopError(t *testing.T) {
+	log := &testLogger{}
+	want := stubError("receiver stop failed")
+	h := NewBuilder(log, stubReceiver{err: want}).
+		WithStopSignals(syscall.SIGUSR2).
+		Build()
+
+	done := make(chan struct{})
+	go func() {
+		h.Loop()
+		close(done)
+	}()
+
+	// Loop registers its signal.Notify asynchronously relative to this
+	// goroutine starting, so resend until it's had a chance to land.
+	for {
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+			t.Fatalf("Kill: %v", err)
+		}
+		select {
+		case <-done:
+		case <-time.After(50 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	found := false
+	for _, l := range log.logs {
+		if l == "receiver stop failed" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Loop did not log the receiver's Stop error, got logs: %v", log.logs)
+	}
+}
+
+func TestHandlerStopCancelsContextAndUnblocksLoop(t *testing.T) {
+	h := NewHandler(&testLogger{})
+
+	done := make(chan struct{})
+	go func() {
+		h.Loop()
+		close(done)
+	}()
+
+	h.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Loop did not return after Stop")
+	}
+
+	select {
+	case <-h.Context().Done():
+	default:
+		t.Fatal("Context was not canceled after Stop")
+	}
+}